@@ -0,0 +1,180 @@
+// Copyright 2016 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/syzkaller/pkg/osutil"
+)
+
+// diskCache persists resolved identifiers across syz-extract invocations,
+// keyed on everything that could change their value: the OS/arch, the cpp
+// environment (includes/incdirs/defines/cflags), the set of identifiers
+// asked for, and a fingerprint of the header tree they were resolved
+// against. A repeated "make extract" where neither the descriptions nor
+// the kernel changed hits this cache for every file and never shells out
+// to cpp at all.
+type diskCache struct {
+	dir    string // empty disables the cache
+	strict bool   // fingerprint header trees by content instead of mtime+size
+
+	mu           sync.Mutex
+	fingerprints map[string]*fingerprintEntry // memoized fingerprintTree results, keyed by sorted roots
+	walks        int32                        // number of times fingerprintTree actually walked a tree; test-only
+}
+
+// fingerprintEntry makes sure a given roots list is only ever walked once
+// per run, however many files ask for its fingerprint concurrently.
+type fingerprintEntry struct {
+	once sync.Once
+	val  string
+}
+
+func newDiskCache(dir string, strict bool) *diskCache {
+	return &diskCache{dir: dir, strict: strict, fingerprints: make(map[string]*fingerprintEntry)}
+}
+
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "syz-extract")
+}
+
+type cacheEntry struct {
+	Origins map[string]constOrigin `json:"origins"`
+	Headers []string               `json:"headers"`
+}
+
+// key computes the cache key for resolving ident.vals against arch/ident's
+// environment, given the set of header roots that environment's includes
+// are actually found under.
+func (c *diskCache) key(arch *Arch, ident *identSet, roots []string) string {
+	vals := append([]string{}, ident.vals...)
+	sort.Strings(vals)
+	includes := append([]string{}, ident.includes...)
+	sort.Strings(includes)
+	incdirs := append([]string{}, ident.incdirs...)
+	sort.Strings(incdirs)
+	defines := make([]string, 0, len(ident.defines))
+	for k, v := range ident.defines {
+		defines = append(defines, k+"="+v)
+	}
+	sort.Strings(defines)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "os=%v\narch=%v\ncflags=%v\nincludes=%v\nincdirs=%v\ndefines=%v\nvals=%v\ntree=%v\n",
+		*flagOS, *flagArch, strings.Join(arch.CFlags, ","), strings.Join(includes, ","),
+		strings.Join(incdirs, ","), strings.Join(defines, ","), strings.Join(vals, ","),
+		c.fingerprintTreeCached(roots))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// fingerprintTreeCached is fingerprintTree, memoized per distinct roots
+// list. Every input file in a run shares the same (or near-identical)
+// roots, so without memoizing this a full-tree extract would walk the
+// entire kernel checkout once per input file instead of once per run.
+func (c *diskCache) fingerprintTreeCached(roots []string) string {
+	sorted := append([]string{}, roots...)
+	sort.Strings(sorted)
+	key := strings.Join(sorted, "\x00")
+
+	c.mu.Lock()
+	e, ok := c.fingerprints[key]
+	if !ok {
+		e = &fingerprintEntry{}
+		c.fingerprints[key] = e
+	}
+	c.mu.Unlock()
+
+	e.once.Do(func() { e.val = c.fingerprintTree(roots) })
+	return e.val
+}
+
+// fingerprintTree cheaply fingerprints every regular file reachable from
+// roots by hashing their path+mtime+size (or, in -cache-strict mode, their
+// contents). This is meant to notice "the kernel checkout changed" without
+// re-reading every header on every invocation.
+func (c *diskCache) fingerprintTree(roots []string) string {
+	atomic.AddInt32(&c.walks, 1)
+	h := sha256.New()
+	var paths []string
+	seen := make(map[string]bool)
+	for _, root := range roots {
+		if root == "" || seen[root] {
+			continue
+		}
+		seen[root] = true
+		_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			paths = append(paths, path)
+			return nil
+		})
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if c.strict {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(h, "%v:%x\n", path, sha256.Sum256(data))
+			continue
+		}
+		fmt.Fprintf(h, "%v:%v:%v\n", path, info.ModTime().UnixNano(), info.Size())
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *diskCache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key+".json")
+}
+
+func (c *diskCache) load(key string) (map[string]constOrigin, []string, bool) {
+	if c.dir == "" {
+		return nil, nil, false
+	}
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, nil, false
+	}
+	var entry cacheEntry
+	if json.Unmarshal(data, &entry) != nil {
+		return nil, nil, false
+	}
+	return entry.Origins, entry.Headers, true
+}
+
+func (c *diskCache) store(key string, origins map[string]constOrigin, headers []string) {
+	if c.dir == "" {
+		return
+	}
+	data, err := json.Marshal(cacheEntry{Origins: origins, Headers: headers})
+	if err != nil {
+		return
+	}
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return
+	}
+	osutil.WriteFile(path, data)
+}
@@ -0,0 +1,48 @@
+// Copyright 2016 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestDiskCacheFingerprintTreeIsMemoized(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 50; i++ {
+		name := filepath.Join(root, "hdr"+string(rune('a'+i))+".h")
+		if err := os.WriteFile(name, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := newDiskCache(t.TempDir(), false)
+	roots := []string{root}
+
+	const n = 20
+	var wg sync.WaitGroup
+	results := make([]string, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = c.fingerprintTreeCached(roots)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 1; i < n; i++ {
+		if results[i] != results[0] {
+			t.Errorf("fingerprint %d differs from fingerprint 0", i)
+		}
+	}
+	if len(c.fingerprints) != 1 {
+		t.Errorf("got %d memoized fingerprint entries for 1 distinct roots list, want 1", len(c.fingerprints))
+	}
+	if c.walks != 1 {
+		t.Errorf("tree walked %d times for %d concurrent callers with the same roots, want 1", c.walks, n)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2016 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// constPrefix is glued in front of every identifier we ask the preprocessor
+// about, so that the expansions we care about can be picked out of a cpp
+// dump that also contains every #define made by the included headers.
+const constPrefix = "SYZCONST_"
+
+// constOrigin is a constant's resolved value together with the header
+// file/line cpp found its definition in, when that could be determined.
+// File/Line are best-effort: they come from grepping the headers cpp
+// reported visiting via -H, not from the preprocessor itself, so a macro
+// built up across several headers may be attributed to the wrong one.
+type constOrigin struct {
+	Value uint64
+	File  string
+	Line  int
+}
+
+// fetchValsViaCPP resolves valArr into numeric values by generating a small
+// C source file that references every identifier from behind constPrefix
+// and letting the C preprocessor expand it for us, then parsing the
+// resulting "SYZCONST_<name> <value>" lines. Only identifiers that expand
+// to a single integer literal are resolved; ones that expand to an
+// expression (e.g. "(1 << 3)") are left out of the result. It also asks
+// cpp (-H) which headers it visited to satisfy those includes, and reports
+// the header/line where each resolved identifier is #defined (as found by
+// findDefinition), for the -manifest mode's provenance output. It is
+// shared by every OS's extractor; only the compiler binary and the
+// flags/include paths passed in args differ.
+func fetchValsViaCPP(cc string, args, valArr, includes []string, defines map[string]string) (map[string]constOrigin, []string, error) {
+	var src strings.Builder
+	for _, inc := range includes {
+		fmt.Fprintf(&src, "#include <%v>\n", inc)
+	}
+	for define, value := range defines {
+		if value == "" {
+			value = "1"
+		}
+		fmt.Fprintf(&src, "#ifndef %v\n#define %v %v\n#endif\n", define, define, value)
+	}
+	for _, val := range valArr {
+		fmt.Fprintf(&src, "#ifdef %v\n%v%v %v\n#endif\n", val, constPrefix, val, val)
+	}
+
+	cmdArgs := append([]string{"-E", "-dD", "-H", "-x", "c", "-"}, args...)
+	cmd := exec.Command(cc, cmdArgs...)
+	cmd.Stdin = strings.NewReader(src.String())
+	stderr := new(strings.Builder)
+	cmd.Stderr = stderr
+	stdout, err := cmd.Output()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to run %v: %v\n%v", cc, err, stderr.String())
+	}
+
+	headers := parseHeadersUsed(stderr.String())
+
+	values := make(map[string]uint64)
+	s := bufio.NewScanner(strings.NewReader(string(stdout)))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 2 || !strings.HasPrefix(fields[0], constPrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(fields[0], constPrefix)
+		v, err := strconv.ParseUint(strings.TrimRight(fields[1], "UL"), 0, 64)
+		if err != nil {
+			continue
+		}
+		values[name] = v
+	}
+
+	res := make(map[string]constOrigin, len(values))
+	for name, v := range values {
+		origin := constOrigin{Value: v}
+		if file, line, ok := findDefinition(headers, name); ok {
+			origin.File, origin.Line = file, line
+		}
+		res[name] = origin
+	}
+	return res, headers, nil
+}
+
+// parseHeadersUsed turns cpp -H's stderr output (one "...." + path per
+// visited header, nesting shown by the number of leading dots) into a flat,
+// deduplicated list of header paths in the order cpp first visited them.
+func parseHeadersUsed(stderr string) []string {
+	var headers []string
+	seen := make(map[string]bool)
+	s := bufio.NewScanner(strings.NewReader(stderr))
+	for s.Scan() {
+		line := s.Text()
+		i := 0
+		for i < len(line) && line[i] == '.' {
+			i++
+		}
+		if i == 0 || i >= len(line) || line[i] != ' ' {
+			continue
+		}
+		path := strings.TrimSpace(line[i+1:])
+		if path == "" || seen[path] {
+			continue
+		}
+		seen[path] = true
+		headers = append(headers, path)
+	}
+	return headers
+}
+
+// findDefinition looks for the #define of ident in the headers cpp visited,
+// most-recently-included first, and returns the first hit.
+func findDefinition(headers []string, ident string) (file string, line int, ok bool) {
+	for i := len(headers) - 1; i >= 0; i-- {
+		f, err := os.Open(headers[i])
+		if err != nil {
+			continue
+		}
+		lineNo := 0
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			lineNo++
+			fields := strings.Fields(s.Text())
+			if len(fields) >= 2 && fields[0] == "#define" && fields[1] == ident {
+				f.Close()
+				return headers[i], lineNo, true
+			}
+		}
+		f.Close()
+	}
+	return "", 0, false
+}
@@ -0,0 +1,103 @@
+// Copyright 2016 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseHeadersUsed(t *testing.T) {
+	tests := []struct {
+		name   string
+		stderr string
+		want   []string
+	}{
+		{
+			name: "nested, in visit order",
+			stderr: ". /usr/include/socket.h\n" +
+				".. /usr/include/bits/socket.h\n" +
+				". /usr/include/fcntl.h\n",
+			want: []string{"/usr/include/socket.h", "/usr/include/bits/socket.h", "/usr/include/fcntl.h"},
+		},
+		{
+			name: "duplicate visits deduplicated, first occurrence kept",
+			stderr: ". /usr/include/socket.h\n" +
+				".. /usr/include/types.h\n" +
+				". /usr/include/fcntl.h\n" +
+				".. /usr/include/types.h\n",
+			want: []string{"/usr/include/socket.h", "/usr/include/types.h", "/usr/include/fcntl.h"},
+		},
+		{
+			name: "non-header noise lines ignored",
+			stderr: "some multi-line\n" +
+				"compiler warning\n" +
+				". /usr/include/socket.h\n",
+			want: []string{"/usr/include/socket.h"},
+		},
+		{
+			name:   "no headers",
+			stderr: "cc1: warning: something\n",
+			want:   nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := parseHeadersUsed(test.stderr)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseHeadersUsed(%q) = %#v, want %#v", test.stderr, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFindDefinition(t *testing.T) {
+	dir := t.TempDir()
+	outer := filepath.Join(dir, "outer.h")
+	inner := filepath.Join(dir, "inner.h")
+	if err := os.WriteFile(outer, []byte("#include <inner.h>\n#define AF_INET 2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(inner, []byte("#define O_RDONLY 0\n#define O_WRONLY 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	headers := []string{outer, inner}
+
+	file, line, ok := findDefinition(headers, "O_WRONLY")
+	if !ok || file != inner || line != 2 {
+		t.Errorf("findDefinition(O_WRONLY) = %v, %v, %v, want %v, 2, true", file, line, ok, inner)
+	}
+
+	file, line, ok = findDefinition(headers, "AF_INET")
+	if !ok || file != outer || line != 2 {
+		t.Errorf("findDefinition(AF_INET) = %v, %v, %v, want %v, 2, true", file, line, ok, outer)
+	}
+
+	if _, _, ok := findDefinition(headers, "NOT_DEFINED"); ok {
+		t.Errorf("findDefinition(NOT_DEFINED) found a definition, want none")
+	}
+
+	if _, _, ok := findDefinition(nil, "AF_INET"); ok {
+		t.Errorf("findDefinition with no headers found a definition, want none")
+	}
+}
+
+func TestFindDefinitionPrefersMostRecentlyIncluded(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.h")
+	second := filepath.Join(dir, "second.h")
+	if err := os.WriteFile(first, []byte("#define AF_INET 2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, []byte("#define AF_INET 2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, _, ok := findDefinition([]string{first, second}, "AF_INET")
+	if !ok || file != second {
+		t.Errorf("findDefinition = %v, %v, want %v, true (most recently visited header wins)", file, ok, second)
+	}
+}
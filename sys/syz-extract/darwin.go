@@ -0,0 +1,31 @@
+// Copyright 2016 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import "path/filepath"
+
+type darwinExtractor struct{}
+
+func (*darwinExtractor) prefix() string { return "SYS_" }
+
+func (*darwinExtractor) archs() map[string]*Arch {
+	return map[string]*Arch{
+		"amd64": {[]string{"__x86_64__"}, "x86_64", "sys/syscall.h", []string{"-m64"}},
+	}
+}
+
+func (*darwinExtractor) fetchValues(arch *Arch, valArr, includes []string, incdirs []string, defines map[string]string) (map[string]constOrigin, []string, error) {
+	sourceDir := *flagLinux
+	args := []string{
+		"-isysroot", sourceDir,
+		"-I" + filepath.Join(sourceDir, "bsd"),
+		"-undef",
+	}
+	for _, incdir := range incdirs {
+		args = append(args, "-I"+incdir)
+	}
+	args = append(args, arch.CFlags...)
+	// Darwin ships clang, not gcc/cpp, as its system compiler.
+	return fetchValsViaCPP("clang", args, valArr, includes, defines)
+}
@@ -0,0 +1,255 @@
+// Copyright 2016 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	. "github.com/google/syzkaller/sys/sysparser"
+)
+
+// runDiff implements the `syz-extract diff` subcommand: it compares two
+// directories of previously-extracted .const files (e.g. an old kernel
+// checkout vs. a new one, or amd64 vs. arm64) and reports constants added,
+// removed or changed between them. Any __NR_*/SYS_* syscall number whose
+// value changed is treated as a hard error, since syscall numbers aren't
+// supposed to get renumbered, unless the name is explicitly whitelisted.
+// It also runs validateExtract against the new side's own sys/*.txt
+// descriptions, when found next to the .const files, so a flag group or
+// resource set that silently collapsed to zero known values on the new
+// kernel is just as much a hard error as a shifted syscall number.
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	flagWhitelist := fs.String("whitelist", "",
+		"comma-separated list of syscall constant names allowed to change number")
+	fs.Parse(args)
+	rest := fs.Args()
+	if len(rest) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: syz-extract diff [-whitelist=NAME,...] old_dir new_dir")
+		return 2
+	}
+	whitelist := make(map[string]bool)
+	if *flagWhitelist != "" {
+		for _, n := range strings.Split(*flagWhitelist, ",") {
+			whitelist[n] = true
+		}
+	}
+
+	oldFiles, err := loadConstDir(rest[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	newFiles, err := loadConstDir(rest[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	names := make(map[string]bool)
+	for n := range oldFiles {
+		names[n] = true
+	}
+	for n := range newFiles {
+		names[n] = true
+	}
+	sortedNames := make([]string, 0, len(names))
+	for n := range names {
+		sortedNames = append(sortedNames, n)
+	}
+	sort.Strings(sortedNames)
+
+	hardErr := false
+	for _, name := range sortedNames {
+		old, hasOld := oldFiles[name]
+		cur, hasNew := newFiles[name]
+		switch {
+		case !hasOld:
+			fmt.Printf("%v: new file\n", name)
+		case !hasNew:
+			fmt.Printf("%v: removed file\n", name)
+		default:
+			if diffConsts(name, old, cur, whitelist) {
+				hardErr = true
+			}
+		}
+		if hasNew {
+			if bad := validateConstFile(rest[1], name, cur); bad {
+				hardErr = true
+			}
+		}
+	}
+	if hardErr {
+		return 1
+	}
+	return 0
+}
+
+// validateConstFile runs validateExtract against a .const file's own
+// description, when one can be found next to it (e.g. sys/linux/socket.txt
+// next to sys/linux/socket_amd64.const), so the diff subcommand catches a
+// pinned-revision bump that silently collapsed a flag group or resource to
+// zero resolved constants, not just a changed syscall number.
+func validateConstFile(dir, constFile string, consts map[string]uint64) bool {
+	descPath, ok := descPathFor(dir, constFile)
+	if !ok {
+		return false
+	}
+	f, err := os.Open(descPath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	problems := validateExtract(Parse(f), consts)
+	for _, problem := range problems {
+		fmt.Printf("%v: ERROR: %v\n", constFile, problem)
+	}
+	return len(problems) > 0
+}
+
+// descPathFor finds the sys/*.txt description a .const file (named
+// "<base>_<arch>.const" by extractFile) was generated from, if it's
+// sitting in the same directory.
+func descPathFor(dir, constFile string) (string, bool) {
+	name := strings.TrimSuffix(constFile, ".const")
+	idx := strings.LastIndex(name, "_")
+	if idx < 0 {
+		return "", false
+	}
+	path := filepath.Join(dir, name[:idx]+".txt")
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+// diffConsts prints the differences between two .const snapshots of the
+// same file and returns true if any of them is a hard error: a syscall
+// number (__NR_*/SYS_*) whose value changed without being whitelisted.
+func diffConsts(file string, old, cur map[string]uint64, whitelist map[string]bool) bool {
+	names := make(map[string]bool)
+	for n := range old {
+		names[n] = true
+	}
+	for n := range cur {
+		names[n] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for n := range names {
+		sorted = append(sorted, n)
+	}
+	sort.Strings(sorted)
+
+	hardErr := false
+	for _, name := range sorted {
+		ov, hasOld := old[name]
+		nv, hasNew := cur[name]
+		switch {
+		case !hasOld:
+			fmt.Printf("%v: %v added = %v\n", file, name, nv)
+		case !hasNew:
+			fmt.Printf("%v: %v removed (was %v)\n", file, name, ov)
+		case ov != nv:
+			fmt.Printf("%v: %v changed %v -> %v\n", file, name, ov, nv)
+			if isSyscallConst(name) && !whitelist[name] {
+				fmt.Printf("%v: ERROR: syscall number %v changed and is not whitelisted\n", file, name)
+				hardErr = true
+			}
+		}
+	}
+	return hardErr
+}
+
+func isSyscallConst(name string) bool {
+	return strings.HasPrefix(name, "__NR_") || strings.HasPrefix(name, "SYS_")
+}
+
+// loadConstDir parses every *.const file directly under dir into a map
+// keyed by filename, each holding that file's name->value constants.
+func loadConstDir(dir string) (map[string]map[string]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %v: %v", dir, err)
+	}
+	files := make(map[string]map[string]uint64)
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".const") {
+			continue
+		}
+		consts, err := loadConstFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files[e.Name()] = consts
+	}
+	return files, nil
+}
+
+func loadConstFile(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	consts := make(map[string]uint64)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		v, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 0, 64)
+		if err != nil {
+			continue
+		}
+		consts[strings.TrimSpace(parts[0])] = v
+	}
+	return consts, s.Err()
+}
+
+// validateExtract checks invariants that should hold after extracting a
+// description: every flag group and resource that declares at least one
+// named value should have resolved at least one of them. It works equally
+// against consts freshly produced by collectIdents/envCache.resolve (an
+// in-memory extract) or loaded back from a .const file written to disk,
+// since it only needs the parsed Description and a name->value map.
+func validateExtract(desc *Description, consts map[string]uint64) []string {
+	var problems []string
+	for group, vals := range desc.Flags {
+		if len(vals) > 0 && countKnown(vals, consts) == 0 {
+			problems = append(problems, fmt.Sprintf("flag group %q resolved no constants (had %d)", group, len(vals)))
+		}
+	}
+	for _, res := range desc.Resources {
+		if len(res.Values) > 0 && countKnown(res.Values, consts) == 0 {
+			problems = append(problems,
+				fmt.Sprintf("resource value set collapsed to zero known values (had %d)", len(res.Values)))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+func countKnown(vals []string, consts map[string]uint64) int {
+	n := 0
+	for _, v := range vals {
+		if _, ok := consts[v]; ok {
+			n++
+		}
+	}
+	return n
+}
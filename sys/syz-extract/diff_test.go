@@ -0,0 +1,129 @@
+// Copyright 2016 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/google/syzkaller/sys/sysparser"
+)
+
+func TestIsSyscallConst(t *testing.T) {
+	cases := []struct {
+		name string
+		want bool
+	}{
+		{"__NR_open", true},
+		{"SYS_open", true},
+		{"AF_INET", false},
+		{"O_RDONLY", false},
+		{"", false},
+	}
+	for _, c := range cases {
+		if got := isSyscallConst(c.name); got != c.want {
+			t.Errorf("isSyscallConst(%q) = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestDiffConstsUnwhitelistedSyscallChangeIsHardError(t *testing.T) {
+	old := map[string]uint64{"AF_INET": 2, "AF_UNIX": 1, "__NR_open": 2}
+	cur := map[string]uint64{"AF_INET": 2, "AF_INET6": 10, "__NR_open": 3}
+
+	if !diffConsts("f.const", old, cur, nil) {
+		t.Fatal("expected a hard error for an unwhitelisted syscall number change")
+	}
+}
+
+func TestDiffConstsWhitelistedSyscallIsNotHardError(t *testing.T) {
+	old := map[string]uint64{"__NR_open": 2}
+	cur := map[string]uint64{"__NR_open": 3}
+
+	if diffConsts("f.const", old, cur, map[string]bool{"__NR_open": true}) {
+		t.Fatal("whitelisted syscall number change should not be a hard error")
+	}
+}
+
+func TestDiffConstsNonSyscallChangeIsNotHardError(t *testing.T) {
+	old := map[string]uint64{"AF_INET": 2}
+	cur := map[string]uint64{"AF_INET": 99}
+
+	if diffConsts("f.const", old, cur, nil) {
+		t.Fatal("a changed non-syscall constant should not be a hard error")
+	}
+}
+
+func TestLoadConstFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "socket_amd64.const")
+	content := "# AUTOGENERATED FILE\nAF_INET = 2\nAF_UNIX = 1\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	consts, err := loadConstFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]uint64{"AF_INET": 2, "AF_UNIX": 1}
+	if len(consts) != len(want) {
+		t.Fatalf("got %v, want %v", consts, want)
+	}
+	for k, v := range want {
+		if consts[k] != v {
+			t.Errorf("consts[%q] = %v, want %v", k, consts[k], v)
+		}
+	}
+}
+
+func TestDescPathFor(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "socket.txt"), []byte{}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if path, ok := descPathFor(dir, "socket_amd64.const"); !ok || path != filepath.Join(dir, "socket.txt") {
+		t.Errorf("descPathFor = %q, %v", path, ok)
+	}
+	if _, ok := descPathFor(dir, "nonexistent_amd64.const"); ok {
+		t.Error("descPathFor should not find a description for a file with none on disk")
+	}
+}
+
+func TestCountKnown(t *testing.T) {
+	consts := map[string]uint64{"A": 1, "B": 2}
+	if n := countKnown([]string{"A", "B", "C"}, consts); n != 2 {
+		t.Errorf("countKnown = %d, want 2", n)
+	}
+	if n := countKnown(nil, consts); n != 0 {
+		t.Errorf("countKnown(nil) = %d, want 0", n)
+	}
+}
+
+func TestValidateExtractReportsCollapsedGroups(t *testing.T) {
+	desc := &Description{
+		Flags: map[string][]string{
+			"sock_flags": {"SOCK_STREAM", "SOCK_DGRAM"},
+			"empty_decl": {}, // no declared values at all: not a collapse
+		},
+		Resources: []Resource{
+			{Values: []string{"AF_INET", "AF_UNIX"}},
+		},
+	}
+
+	// Nothing resolved for either the flag group or the resource: both
+	// should be reported.
+	problems := validateExtract(desc, map[string]uint64{})
+	if len(problems) != 2 {
+		t.Fatalf("got %d problems, want 2: %v", len(problems), problems)
+	}
+
+	// Once at least one value from each resolves, there's nothing to report.
+	problems = validateExtract(desc, map[string]uint64{"SOCK_STREAM": 1, "AF_INET": 2})
+	if len(problems) != 0 {
+		t.Fatalf("got %d problems, want 0: %v", len(problems), problems)
+	}
+}
@@ -9,20 +9,32 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/google/syzkaller/pkg/osutil"
 	. "github.com/google/syzkaller/sys/sysparser"
 )
 
 var (
-	flagLinux    = flag.String("linux", "", "path to linux kernel source checkout")
-	flagLinuxBld = flag.String("linuxbld", "", "path to linux kernel build directory")
-	flagArch     = flag.String("arch", "", "arch to generate")
-	flagV        = flag.Int("v", 0, "verbosity")
+	flagOS = flag.String("os", "linux", "target OS to extract constants for")
+	// flagLinux/flagLinuxBld are named after their original Linux-only
+	// purpose but are reused by every extractor as the generic "source
+	// checkout"/"build directory" pair.
+	flagLinux       = flag.String("linux", "", "path to kernel/OS source checkout")
+	flagLinuxBld    = flag.String("linuxbld", "", "path to kernel/OS build directory")
+	flagArch        = flag.String("arch", "", "arch to generate")
+	flagV           = flag.Int("v", 0, "verbosity")
+	flagJ           = flag.Int("j", 4, "number of input files to extract in parallel")
+	flagManifest    = flag.Bool("manifest", false, "write a .manifest.json file alongside each .const file")
+	flagCache       = flag.String("cache", defaultCacheDir(), "content-addressed extraction cache dir (empty disables caching)")
+	flagCacheStrict = flag.Bool("cache-strict", false, "fingerprint the header tree by content instead of mtime+size")
 )
 
+// Arch describes how the C preprocessor should be invoked to resolve
+// constants for a single target architecture.
 type Arch struct {
 	CARCH            []string
 	KernelHeaderArch string
@@ -30,48 +42,134 @@ type Arch struct {
 	CFlags           []string
 }
 
-var archs = map[string]*Arch{
-	"amd64":   {[]string{"__x86_64__"}, "x86", "asm/unistd.h", []string{"-m64"}},
-	"arm64":   {[]string{"__aarch64__"}, "arm64", "asm/unistd.h", []string{}},
-	"ppc64le": {[]string{"__ppc64__", "__PPC64__", "__powerpc64__"}, "powerpc", "asm/unistd.h", []string{"-D__powerpc64__"}},
+// extractor is implemented once per target OS. It knows that OS's kernel
+// source layout, default include headers and how to turn a list of
+// identifiers into their numeric values for each arch it supports.
+type extractor interface {
+	// archs returns the set of arches this OS can be extracted for.
+	archs() map[string]*Arch
+	// prefix returns the prefix prepended to syscall names when resolving
+	// __NR_-style syscall number constants (e.g. "__NR_" on Linux).
+	prefix() string
+	// fetchValues resolves each identifier in valArr into a numeric value
+	// (plus, best-effort, the header it was defined in), using
+	// includes/incdirs/defines gathered from the parsed description in
+	// addition to whatever headers/flags are specific to this OS. It also
+	// returns the list of headers actually visited to resolve them.
+	fetchValues(arch *Arch, valArr, includes []string, incdirs []string, defines map[string]string) (map[string]constOrigin, []string, error)
+}
+
+var extractors = map[string]extractor{
+	"linux":   &linuxExtractor{},
+	"freebsd": &freebsdExtractor{},
+	"netbsd":  &netbsdExtractor{},
+	"openbsd": &openbsdExtractor{},
+	"darwin":  &darwinExtractor{},
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		os.Exit(runDiff(os.Args[2:]))
+	}
 	flag.Parse()
+	ext := extractors[*flagOS]
+	if ext == nil {
+		failf("unknown os %v", *flagOS)
+	}
 	if *flagLinux == "" {
-		failf("provide path to linux kernel checkout via -linux flag (or make extract LINUX= flag)")
+		failf("provide path to kernel source checkout via -linux flag (or make extract SOURCEDIR= flag)")
 	}
 	if *flagLinuxBld == "" {
-		logf(1, "No kernel build directory provided, assuming in-place build")
+		logf(1, "no kernel build directory provided, assuming in-place build")
 		*flagLinuxBld = *flagLinux
 	}
 	if *flagArch == "" {
 		failf("-arch flag is required")
 	}
-	if archs[*flagArch] == nil {
-		failf("unknown arch %v", *flagArch)
+	if *flagJ < 1 {
+		failf("-j must be at least 1, got %v", *flagJ)
 	}
-	if len(flag.Args()) != 1 {
-		failf("usage: syz-extract -linux=/linux/checkout -arch=arch sys/input_file.txt")
+	arch := ext.archs()[*flagArch]
+	if arch == nil {
+		failf("unknown arch %v for os %v", *flagArch, *flagOS)
+	}
+	files, err := expandFiles(flag.Args())
+	if err != nil {
+		failf("%v", err)
+	}
+	if len(files) == 0 {
+		failf("usage: syz-extract -os=os -linux=/kernel/checkout -arch=arch sys/*.txt")
 	}
 
-	inname := flag.Args()[0]
-	outname := strings.TrimSuffix(inname, ".txt") + "_" + *flagArch + ".const"
+	cache := newEnvCache()
+	disk := newDiskCache(*flagCache, *flagCacheStrict)
+	sem := make(chan struct{}, *flagJ)
+	var wg sync.WaitGroup
+	for _, inname := range files {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(inname string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			extractFile(ext, arch, cache, disk, inname)
+		}(inname)
+	}
+	wg.Wait()
+}
 
-	inf, err := os.Open(inname)
+// extractFile resolves and writes the .const file (and, with -manifest, its
+// sibling manifest) for a single input description. It is safe to call
+// concurrently for different files sharing the same envCache/diskCache.
+func extractFile(ext extractor, arch *Arch, cache *envCache, disk *diskCache, inname string) {
+	raw, err := os.ReadFile(inname)
 	if err != nil {
 		failf("failed to open input file: %v", err)
 	}
-	defer inf.Close()
+	desc := Parse(bytes.NewReader(raw))
+
+	ident := collectIdents(ext, arch, desc)
+	var origins map[string]constOrigin
+	var headers []string
+	if ident != nil {
+		roots := append([]string{*flagLinux, *flagLinuxBld}, ident.incdirs...)
+		key := disk.key(arch, ident, roots)
+		var hit bool
+		origins, headers, hit = disk.load(key)
+		if !hit {
+			origins, headers, err = cache.resolve(ext, arch, ident)
+			if err != nil {
+				failf("%v: %v", inname, err)
+			}
+			disk.store(key, origins, headers)
+		} else {
+			logf(1, "%v: cache hit", inname)
+		}
+	}
 
-	desc := Parse(inf)
-	consts := compileConsts(archs[*flagArch], desc)
+	consts := make(map[string]uint64, len(origins))
+	for name, o := range origins {
+		consts[name] = o.Value
+	}
+	if problems := validateExtract(desc, consts); len(problems) > 0 {
+		for _, problem := range problems {
+			logf(0, "%v: %v", inname, problem)
+		}
+		failf("%v: extraction failed validation (%d problem(s))", inname, len(problems))
+	}
 
 	out := new(bytes.Buffer)
 	generateConsts(*flagArch, consts, out)
+
+	outname := strings.TrimSuffix(inname, ".txt") + "_" + *flagArch + ".const"
 	if err := osutil.WriteFile(outname, out.Bytes()); err != nil {
 		failf("failed to write output file: %v", err)
 	}
+
+	if *flagManifest {
+		if err := writeManifest(inname, outname, raw, arch, ident, origins, headers); err != nil {
+			failf("failed to write manifest for %v: %v", inname, err)
+		}
+	}
 }
 
 func generateConsts(arch string, consts map[string]uint64, out io.Writer) {
@@ -87,45 +185,25 @@ func generateConsts(arch string, consts map[string]uint64, out io.Writer) {
 	}
 }
 
-func compileConsts(arch *Arch, desc *Description) map[string]uint64 {
-	vals := make(map[string]bool)
-	for _, fvals := range desc.Flags {
-		for _, v := range fvals {
-			vals[v] = true
+// expandFiles turns glob patterns in args (e.g. "sys/freebsd/*.txt") into a
+// flat, sorted list of input files. Args that aren't patterns, or that
+// don't match anything, are passed through unchanged so a typo still
+// surfaces as a normal "failed to open input file" error.
+func expandFiles(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("bad glob %q: %v", arg, err)
 		}
-	}
-	for v := range desc.Defines {
-		vals[v] = true
-	}
-	for _, sc := range desc.Syscalls {
-		if strings.HasPrefix(sc.CallName, "syz_") {
+		if len(matches) == 0 {
+			files = append(files, arg)
 			continue
 		}
-		name := "__NR_" + sc.CallName
-		vals[name] = true
-	}
-	for _, res := range desc.Resources {
-		for _, v := range res.Values {
-			vals[v] = true
-		}
-	}
-
-	valArr := make([]string, 0, len(vals))
-	for v := range vals {
-		if !isIdentifier(v) {
-			continue
-		}
-		valArr = append(valArr, v)
-	}
-	if len(valArr) == 0 {
-		return nil
-	}
-
-	consts, err := fetchValues(arch.KernelHeaderArch, valArr, append(desc.Includes, arch.KernelInclude), desc.Incdirs, desc.Defines, arch.CFlags)
-	if err != nil {
-		failf("%v", err)
+		files = append(files, matches...)
 	}
-	return consts
+	sort.Strings(files)
+	return files, nil
 }
 
 func isIdentifier(s string) bool {
@@ -0,0 +1,93 @@
+// Copyright 2016 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractors(t *testing.T) {
+	tests := []struct {
+		ext    extractor
+		prefix string
+		archs  map[string]*Arch
+	}{
+		{
+			&linuxExtractor{},
+			"__NR_",
+			map[string]*Arch{
+				"amd64":   {[]string{"__x86_64__"}, "x86", "asm/unistd.h", []string{"-m64"}},
+				"arm64":   {[]string{"__aarch64__"}, "arm64", "asm/unistd.h", []string{}},
+				"ppc64le": {[]string{"__ppc64__", "__PPC64__", "__powerpc64__"}, "powerpc", "asm/unistd.h", []string{"-D__powerpc64__"}},
+			},
+		},
+		{
+			&freebsdExtractor{},
+			"SYS_",
+			map[string]*Arch{
+				"amd64": {[]string{"__x86_64__"}, "amd64", "sys/syscall.h", []string{"-m64"}},
+			},
+		},
+		{
+			&netbsdExtractor{},
+			"SYS_",
+			map[string]*Arch{
+				"amd64": {[]string{"__x86_64__"}, "amd64", "sys/syscall.h", []string{"-m64"}},
+			},
+		},
+		{
+			&openbsdExtractor{},
+			"SYS_",
+			map[string]*Arch{
+				"amd64": {[]string{"__x86_64__"}, "amd64", "sys/syscall.h", []string{"-m64"}},
+			},
+		},
+		{
+			&darwinExtractor{},
+			"SYS_",
+			map[string]*Arch{
+				"amd64": {[]string{"__x86_64__"}, "x86_64", "sys/syscall.h", []string{"-m64"}},
+			},
+		},
+	}
+	for _, test := range tests {
+		name := reflect.TypeOf(test.ext).Elem().Name()
+		t.Run(name, func(t *testing.T) {
+			if got := test.ext.prefix(); got != test.prefix {
+				t.Errorf("prefix() = %q, want %q", got, test.prefix)
+			}
+			got := test.ext.archs()
+			if !reflect.DeepEqual(got, test.archs) {
+				t.Errorf("archs() = %#v, want %#v", got, test.archs)
+			}
+		})
+	}
+}
+
+// TestExtractorsRegistered checks that every extractor type above is also
+// reachable via the -os flag, so a new extractor can't be added to one
+// table and forgotten in the other.
+func TestExtractorsRegistered(t *testing.T) {
+	want := map[string]string{
+		"linux":   "*main.linuxExtractor",
+		"freebsd": "*main.freebsdExtractor",
+		"netbsd":  "*main.netbsdExtractor",
+		"openbsd": "*main.openbsdExtractor",
+		"darwin":  "*main.darwinExtractor",
+	}
+	if len(extractors) != len(want) {
+		t.Fatalf("got %d registered extractors, want %d", len(extractors), len(want))
+	}
+	for os, typ := range want {
+		ext, ok := extractors[os]
+		if !ok {
+			t.Errorf("no extractor registered for os %q", os)
+			continue
+		}
+		if got := reflect.TypeOf(ext).String(); got != typ {
+			t.Errorf("extractors[%q] has type %v, want %v", os, got, typ)
+		}
+	}
+}
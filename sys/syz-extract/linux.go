@@ -0,0 +1,40 @@
+// Copyright 2016 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import "path/filepath"
+
+type linuxExtractor struct{}
+
+func (*linuxExtractor) prefix() string { return "__NR_" }
+
+func (*linuxExtractor) archs() map[string]*Arch {
+	return map[string]*Arch{
+		"amd64":   {[]string{"__x86_64__"}, "x86", "asm/unistd.h", []string{"-m64"}},
+		"arm64":   {[]string{"__aarch64__"}, "arm64", "asm/unistd.h", []string{}},
+		"ppc64le": {[]string{"__ppc64__", "__PPC64__", "__powerpc64__"}, "powerpc", "asm/unistd.h", []string{"-D__powerpc64__"}},
+	}
+}
+
+func (*linuxExtractor) fetchValues(arch *Arch, valArr, includes []string, incdirs []string, defines map[string]string) (map[string]constOrigin, []string, error) {
+	sourceDir, buildDir := *flagLinux, *flagLinuxBld
+	args := []string{
+		"-I" + filepath.Join(sourceDir, "arch", arch.KernelHeaderArch, "include"),
+		"-I" + filepath.Join(buildDir, "arch", arch.KernelHeaderArch, "include", "generated"),
+		"-I" + filepath.Join(sourceDir, "include"),
+		"-I" + filepath.Join(buildDir, "include"),
+		"-I" + filepath.Join(sourceDir, "arch", arch.KernelHeaderArch, "include", "uapi"),
+		"-I" + filepath.Join(buildDir, "arch", arch.KernelHeaderArch, "include", "generated", "uapi"),
+		"-I" + filepath.Join(sourceDir, "include", "uapi"),
+		"-I" + filepath.Join(buildDir, "include", "generated", "uapi"),
+		"-I" + sourceDir,
+		"-nostdinc",
+		"-undef",
+	}
+	for _, incdir := range incdirs {
+		args = append(args, "-I"+incdir)
+	}
+	args = append(args, arch.CFlags...)
+	return fetchValsViaCPP("cpp", args, valArr, includes, defines)
+}
@@ -0,0 +1,79 @@
+// Copyright 2016 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/google/syzkaller/pkg/osutil"
+)
+
+// manifest is the -manifest mode's machine-readable record of how a single
+// .const file was produced, so downstream tooling can diff constants across
+// kernel revisions/arches without re-running cpp.
+type manifest struct {
+	SourceFile  string          `json:"source_file"`
+	SourceHash  string          `json:"source_hash"`
+	OS          string          `json:"os"`
+	Arch        string          `json:"arch"`
+	SourceRev   string          `json:"source_rev,omitempty"`
+	Includes    []string        `json:"includes"`
+	HeadersUsed []string        `json:"headers_used"`
+	CFlags      []string        `json:"cflags"`
+	Consts      []manifestConst `json:"consts"`
+}
+
+type manifestConst struct {
+	Name  string `json:"name"`
+	Value uint64 `json:"value"`
+	File  string `json:"file,omitempty"`
+	Line  int    `json:"line,omitempty"`
+}
+
+// writeManifest builds and writes the manifest for one extracted input
+// file, as <outname-without-.const>.manifest.json.
+func writeManifest(inname, outname string, raw []byte, arch *Arch, ident *identSet,
+	origins map[string]constOrigin, headers []string) error {
+	sum := sha256.Sum256(raw)
+
+	m := manifest{
+		SourceFile:  inname,
+		SourceHash:  hex.EncodeToString(sum[:]),
+		OS:          *flagOS,
+		Arch:        *flagArch,
+		SourceRev:   sourceRevision(*flagLinux),
+		HeadersUsed: headers,
+		CFlags:      arch.CFlags,
+	}
+	if ident != nil {
+		m.Includes = ident.includes
+	}
+
+	for name, o := range origins {
+		m.Consts = append(m.Consts, manifestConst{Name: name, Value: o.Value, File: o.File, Line: o.Line})
+	}
+	sort.Slice(m.Consts, func(i, j int) bool { return m.Consts[i].Name < m.Consts[j].Name })
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	manifestName := strings.TrimSuffix(outname, ".const") + ".manifest.json"
+	return osutil.WriteFile(manifestName, append(data, '\n'))
+}
+
+// sourceRevision returns the git HEAD SHA of dir, or "" if dir isn't a git
+// checkout (e.g. a bare kernel tarball extract).
+func sourceRevision(dir string) string {
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,127 @@
+// Copyright 2016 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteManifest(t *testing.T) {
+	dir := t.TempDir()
+	*flagOS, *flagArch = "linux", "amd64"
+	defer func() { *flagOS, *flagArch = "linux", "" }()
+
+	inname := filepath.Join(dir, "socket.txt")
+	outname := filepath.Join(dir, "socket_amd64.const")
+	raw := []byte("resource fd[int32]\n")
+	arch := &Arch{CARCH: []string{"__x86_64__"}, CFlags: []string{"-m64"}}
+	ident := &identSet{includes: []string{"sys/socket.h"}}
+	origins := map[string]constOrigin{
+		"AF_INET": {Value: 2, File: "/usr/include/socket.h", Line: 42},
+	}
+	headers := []string{"/usr/include/socket.h"}
+
+	if err := writeManifest(inname, outname, raw, arch, ident, origins, headers); err != nil {
+		t.Fatalf("writeManifest: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "socket_amd64.manifest.json"))
+	if err != nil {
+		t.Fatalf("reading manifest: %v", err)
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("unmarshaling manifest: %v", err)
+	}
+
+	if m.SourceFile != inname {
+		t.Errorf("SourceFile = %q, want %q", m.SourceFile, inname)
+	}
+	if m.OS != "linux" || m.Arch != "amd64" {
+		t.Errorf("OS/Arch = %v/%v, want linux/amd64", m.OS, m.Arch)
+	}
+	if len(m.Includes) != 1 || m.Includes[0] != "sys/socket.h" {
+		t.Errorf("Includes = %v, want [sys/socket.h]", m.Includes)
+	}
+	if len(m.HeadersUsed) != 1 || m.HeadersUsed[0] != "/usr/include/socket.h" {
+		t.Errorf("HeadersUsed = %v, want %v", m.HeadersUsed, headers)
+	}
+	if len(m.Consts) != 1 || m.Consts[0].Name != "AF_INET" || m.Consts[0].Value != 2 ||
+		m.Consts[0].File != "/usr/include/socket.h" || m.Consts[0].Line != 42 {
+		t.Errorf("Consts = %+v, want [{AF_INET 2 /usr/include/socket.h 42}]", m.Consts)
+	}
+}
+
+func TestWriteManifestConstsSortedByName(t *testing.T) {
+	dir := t.TempDir()
+	*flagOS, *flagArch = "linux", "amd64"
+	defer func() { *flagOS, *flagArch = "linux", "" }()
+
+	outname := filepath.Join(dir, "socket_amd64.const")
+	origins := map[string]constOrigin{
+		"O_WRONLY": {Value: 1},
+		"AF_INET":  {Value: 2},
+		"O_RDONLY": {Value: 0},
+	}
+	if err := writeManifest(outname, outname, nil, &Arch{}, nil, origins, nil); err != nil {
+		t.Fatalf("writeManifest: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "socket_amd64.manifest.json"))
+	if err != nil {
+		t.Fatalf("reading manifest: %v", err)
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("unmarshaling manifest: %v", err)
+	}
+	var names []string
+	for _, c := range m.Consts {
+		names = append(names, c.Name)
+	}
+	want := []string{"AF_INET", "O_RDONLY", "O_WRONLY"}
+	for i := range want {
+		if i >= len(names) || names[i] != want[i] {
+			t.Fatalf("Consts names = %v, want %v", names, want)
+		}
+	}
+}
+
+func TestSourceRevisionNonGitDir(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	if got := sourceRevision(t.TempDir()); got != "" {
+		t.Errorf("sourceRevision(non-git dir) = %q, want empty string", got)
+	}
+}
+
+func TestSourceRevisionGitDir(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	dir := t.TempDir()
+	run := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	run("init", "-q")
+	run("config", "user.email", "test@test.com")
+	run("config", "user.name", "test")
+	if err := os.WriteFile(filepath.Join(dir, "f"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	run("add", "f")
+	run("commit", "-q", "-m", "init")
+
+	rev := sourceRevision(dir)
+	if len(rev) != 40 {
+		t.Errorf("sourceRevision(git dir) = %q, want a 40-char SHA", rev)
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright 2016 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import "path/filepath"
+
+type openbsdExtractor struct{}
+
+func (*openbsdExtractor) prefix() string { return "SYS_" }
+
+func (*openbsdExtractor) archs() map[string]*Arch {
+	return map[string]*Arch{
+		"amd64": {[]string{"__x86_64__"}, "amd64", "sys/syscall.h", []string{"-m64"}},
+	}
+}
+
+func (*openbsdExtractor) fetchValues(arch *Arch, valArr, includes []string, incdirs []string, defines map[string]string) (map[string]constOrigin, []string, error) {
+	sourceDir := *flagLinux
+	args := []string{
+		"-I" + filepath.Join(sourceDir, "sys"),
+		"-I" + filepath.Join(sourceDir, "sys", "arch", arch.KernelHeaderArch, "include"),
+		"-I" + sourceDir,
+		"-nostdinc",
+		"-undef",
+	}
+	for _, incdir := range incdirs {
+		args = append(args, "-I"+incdir)
+	}
+	args = append(args, arch.CFlags...)
+	return fetchValsViaCPP("cpp", args, valArr, includes, defines)
+}
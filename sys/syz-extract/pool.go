@@ -0,0 +1,178 @@
+// Copyright 2016 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	. "github.com/google/syzkaller/sys/sysparser"
+)
+
+// identSet is the result of the "collect identifiers" phase: every
+// identifier a description needs resolved (syscall numbers, flags, defines,
+// resource values), together with the cpp environment it needs resolving
+// in. Building it never shells out, so it's cheap to do for every input
+// file up front, before any of the expensive cpp invocations happen.
+type identSet struct {
+	vals     []string
+	includes []string
+	incdirs  []string
+	defines  map[string]string
+}
+
+func collectIdents(ext extractor, arch *Arch, desc *Description) *identSet {
+	vals := make(map[string]bool)
+	for _, fvals := range desc.Flags {
+		for _, v := range fvals {
+			vals[v] = true
+		}
+	}
+	for v := range desc.Defines {
+		vals[v] = true
+	}
+	for _, sc := range desc.Syscalls {
+		if strings.HasPrefix(sc.CallName, "syz_") {
+			continue
+		}
+		vals[ext.prefix()+sc.CallName] = true
+	}
+	for _, res := range desc.Resources {
+		for _, v := range res.Values {
+			vals[v] = true
+		}
+	}
+
+	valArr := make([]string, 0, len(vals))
+	for v := range vals {
+		if isIdentifier(v) {
+			valArr = append(valArr, v)
+		}
+	}
+	if len(valArr) == 0 {
+		return nil
+	}
+	return &identSet{
+		vals:     valArr,
+		includes: append(append([]string{}, desc.Includes...), arch.KernelInclude),
+		incdirs:  desc.Incdirs,
+		defines:  desc.Defines,
+	}
+}
+
+// envCache deduplicates cpp invocations across files. Many sys/*.txt files
+// share the same includes/incdirs/defines, and thus the same preprocessor
+// environment, so a constant resolved once for a given environment (e.g.
+// AF_INET or O_RDONLY) is reused by every other file extracted with that
+// same environment instead of invoking cpp again. Concurrent resolve calls
+// for the same environment wait on whichever one of them is already
+// fetching instead of each invoking cpp themselves.
+type envCache struct {
+	mu        sync.Mutex
+	resolved  map[string]map[string]constOrigin
+	requested map[string]map[string]bool // vals a fetch has already been attempted for, found or not
+	headers   map[string][]string
+	inflight  map[string]*sync.WaitGroup
+}
+
+func newEnvCache() *envCache {
+	return &envCache{
+		resolved:  make(map[string]map[string]constOrigin),
+		requested: make(map[string]map[string]bool),
+		headers:   make(map[string][]string),
+		inflight:  make(map[string]*sync.WaitGroup),
+	}
+}
+
+func envKey(arch *Arch, ident *identSet) string {
+	includes := append([]string{}, ident.includes...)
+	sort.Strings(includes)
+	incdirs := append([]string{}, ident.incdirs...)
+	sort.Strings(incdirs)
+	defines := make([]string, 0, len(ident.defines))
+	for k, v := range ident.defines {
+		defines = append(defines, k+"="+v)
+	}
+	sort.Strings(defines)
+	return strings.Join(arch.CARCH, ",") + "|" + strings.Join(arch.CFlags, ",") + "|" +
+		strings.Join(includes, ",") + "|" + strings.Join(incdirs, ",") + "|" + strings.Join(defines, ",")
+}
+
+// resolve returns the origin (value + defining header) of every identifier
+// in ident.vals, plus the full list of headers visited to resolve this
+// environment. It invokes ext.fetchValues only for identifiers not already
+// requested for this (includes, incdirs, defines, cflags) environment, and
+// only one goroutine at a time does so per environment: concurrent callers
+// for the same environment (e.g. every sys/linux/*.txt file for amd64)
+// block on the in-flight fetch instead of each invoking cpp themselves.
+func (c *envCache) resolve(ext extractor, arch *Arch, ident *identSet) (map[string]constOrigin, []string, error) {
+	key := envKey(arch, ident)
+
+	for {
+		c.mu.Lock()
+		requested := c.requested[key]
+		var missing []string
+		for _, v := range ident.vals {
+			if !requested[v] {
+				missing = append(missing, v)
+			}
+		}
+		if len(missing) == 0 {
+			res := subsetOrigins(c.resolved[key], ident.vals)
+			headers := c.headers[key]
+			c.mu.Unlock()
+			return res, headers, nil
+		}
+		if wg, ok := c.inflight[key]; ok {
+			// Someone else is already fetching for this environment (maybe
+			// not even the same identifiers); wait for them and re-check.
+			c.mu.Unlock()
+			wg.Wait()
+			continue
+		}
+		wg := new(sync.WaitGroup)
+		wg.Add(1)
+		c.inflight[key] = wg
+		c.mu.Unlock()
+
+		fetched, headers, err := ext.fetchValues(arch, missing, ident.includes, ident.incdirs, ident.defines)
+
+		c.mu.Lock()
+		if err == nil {
+			if c.resolved[key] == nil {
+				c.resolved[key] = make(map[string]constOrigin)
+			}
+			if c.requested[key] == nil {
+				c.requested[key] = make(map[string]bool)
+			}
+			for k, v := range fetched {
+				c.resolved[key][k] = v
+			}
+			for _, v := range missing {
+				c.requested[key][v] = true
+			}
+			if c.headers[key] == nil {
+				c.headers[key] = headers
+			}
+		}
+		delete(c.inflight, key)
+		c.mu.Unlock()
+		wg.Done()
+
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+func subsetOrigins(all map[string]constOrigin, vals []string) map[string]constOrigin {
+	res := make(map[string]constOrigin, len(vals))
+	for _, v := range vals {
+		if origin, ok := all[v]; ok {
+			res[v] = origin
+		}
+	}
+	return res
+}
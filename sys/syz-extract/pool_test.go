@@ -0,0 +1,59 @@
+// Copyright 2016 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingExtractor struct {
+	calls int32
+}
+
+func (*countingExtractor) prefix() string          { return "__NR_" }
+func (*countingExtractor) archs() map[string]*Arch { return nil }
+func (e *countingExtractor) fetchValues(arch *Arch, valArr, includes, incdirs []string,
+	defines map[string]string) (map[string]constOrigin, []string, error) {
+	atomic.AddInt32(&e.calls, 1)
+	time.Sleep(20 * time.Millisecond)
+	res := make(map[string]constOrigin, len(valArr))
+	for _, v := range valArr {
+		res[v] = constOrigin{Value: 1}
+	}
+	return res, []string{"hdr.h"}, nil
+}
+
+func TestEnvCacheResolveDedupsConcurrentCallers(t *testing.T) {
+	ext := &countingExtractor{}
+	arch := &Arch{CARCH: []string{"__x86_64__"}, CFlags: []string{"-m64"}}
+	ident := &identSet{
+		vals:     []string{"AF_INET", "O_RDONLY"},
+		includes: []string{"sys/socket.h"},
+	}
+	cache := newEnvCache()
+
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, _, err := cache.resolve(ext, arch, ident)
+			if err != nil {
+				t.Errorf("resolve: %v", err)
+			}
+			if len(res) != len(ident.vals) {
+				t.Errorf("got %d resolved vals, want %d", len(res), len(ident.vals))
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&ext.calls); got != 1 {
+		t.Errorf("fetchValues called %d times for %d concurrent callers of the same environment, want 1", got, n)
+	}
+}